@@ -0,0 +1,307 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"chatstreamapp/internal/hub"
+	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/models"
+	"chatstreamapp/pkg/authtoken"
+	basehub "chatstreamapp/pkg/hub"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// helloDeadline bounds how long a newly-upgraded connection has to send its
+// hello before it's dropped.
+const helloDeadline = 5 * time.Second
+
+// incomingMessage is the shape of a client's WebSocket frame once past the
+// hello handshake.
+type incomingMessage struct {
+	Type    string `json:"type"`
+	Room    string `json:"room,omitempty"`
+	To      string `json:"to,omitempty"`
+	Content string `json:"content,omitempty"`
+
+	// populated when Type == "danmaku"
+	PlaybackOffsetMs int64  `json:"playbackOffsetMs,omitempty"`
+	Color            string `json:"color,omitempty"`
+	Position         string `json:"position,omitempty"`
+}
+
+// wsTransport adapts a WebSocket connection to basehub.Transport, so a
+// wsClient's outbound writes go through basehub.SlowConsumerTransport's
+// bounded queue instead of hitting the socket directly.
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *wsTransport) Deliver(env *basehub.Envelope) error {
+	msg, ok := env.Payload.(*models.Message)
+	if !ok {
+		return fmt.Errorf("ws transport: unexpected payload type %T", env.Payload)
+	}
+	return t.conn.WriteJSON(msg)
+}
+
+func (t *wsTransport) Close() error { return nil }
+
+// wsClient implements hub.Client over a WebSocket connection. SendMessage is
+// non-blocking: writes go through a basehub.SlowConsumerTransport, so a slow
+// reader can't stall the hub goroutine delivering to it. This is the only
+// bounded queue a message passes through on its way out; the room's Transport
+// is a plain, unbuffered adapter around this client (see clientTransport),
+// since wrapping it in a second SlowConsumerTransport would queue on top of
+// this one without ever observing real socket backpressure.
+type wsClient struct {
+	conn *websocket.Conn
+	user *models.User
+
+	mu     sync.RWMutex
+	roomID string
+
+	transport *basehub.SlowConsumerTransport
+}
+
+// newWSClient returns a wsClient ready to register with h.
+func newWSClient(h *hub.Hub, conn *websocket.Conn, user *models.User) *wsClient {
+	c := &wsClient{conn: conn, user: user}
+	c.transport = basehub.NewSlowConsumerTransport(&wsTransport{conn: conn}, basehub.DefaultWatermarks, func() {
+		logger.Errorf("user %s exceeded the drop threshold, disconnecting as a slow consumer", user.ID)
+		// This callback runs synchronously on whatever goroutine is
+		// broadcasting to this client, normally Hub.Run() itself. Unregister
+		// sends on an unbuffered channel only Run() reads, so calling it
+		// synchronously here would deadlock Run() against itself; dispatch
+		// it on its own goroutine instead.
+		go h.Unregister(c)
+	})
+	return c
+}
+
+func (c *wsClient) SendMessage(message *models.Message) {
+	c.transport.Deliver(&basehub.Envelope{Payload: message})
+}
+
+func (c *wsClient) GetUser() *models.User { return c.user }
+
+func (c *wsClient) GetRoomID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.roomID
+}
+
+func (c *wsClient) SetRoomID(roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roomID = roomID
+}
+
+// SetupRoutes wires the chat WebSocket route. secret is the shared HMAC key
+// clients must sign their hello handshake with, and nonces tracks used
+// nonces so a captured hello can't be replayed within the clock-skew
+// window.
+func SetupRoutes(r *gin.Engine, h *hub.Hub, secret []byte, nonces *authtoken.NonceCache) {
+	r.GET("/ws", func(c *gin.Context) {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			logger.Errorf("websocket upgrade error: %v", err)
+			return
+		}
+
+		user, ok := performHandshake(conn, secret, nonces)
+		if !ok {
+			conn.Close()
+			return
+		}
+
+		client := newWSClient(h, conn, user)
+		h.Register(client)
+		defer func() {
+			h.Unregister(client)
+			client.transport.Close()
+			conn.Close()
+		}()
+
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				logger.Errorf("read error: %v", err)
+				return
+			}
+
+			var in incomingMessage
+			if err := json.Unmarshal(msg, &in); err != nil {
+				logger.Errorf("invalid payload: %v", err)
+				continue
+			}
+
+			switch in.Type {
+			case "join":
+				h.JoinRoom(client, in.Room)
+
+			case "leave":
+				h.LeaveRoom(client, in.Room)
+
+			case "message":
+				h.Broadcast(&models.Message{
+					ID:        uuid.New().String(),
+					Type:      models.MessageTypeChat,
+					Content:   in.Content,
+					Sender:    user.Username,
+					Room:      client.GetRoomID(),
+					Timestamp: time.Now(),
+				})
+
+			case "private":
+				h.SendToUser(in.To, &models.Message{
+					ID:        uuid.New().String(),
+					Type:      models.MessageTypeChat,
+					Content:   in.Content,
+					Sender:    user.Username,
+					Timestamp: time.Now(),
+				})
+
+			case "danmaku":
+				h.BroadcastDanmaku(&hub.DanmakuMessage{
+					RoomID:           client.GetRoomID(),
+					Text:             in.Content,
+					PlaybackOffsetMs: in.PlaybackOffsetMs,
+					Color:            in.Color,
+					Position:         in.Position,
+				})
+
+			default:
+				logger.Errorf("unknown message type %q from user %s", in.Type, user.ID)
+			}
+		}
+	})
+
+	r.GET("/rooms/:id/history", func(c *gin.Context) { handleHistory(c, h) })
+	r.GET("/rooms/:id/playback", func(c *gin.Context) { handleGetPlayback(c, h) })
+	r.PUT("/rooms/:id/playback", func(c *gin.Context) { handleSetPlayback(c, h) })
+
+	r.GET("/healthz", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
+}
+
+// playbackRequest is the body of a PUT /rooms/:id/playback request.
+type playbackRequest struct {
+	Action   string `json:"action"`
+	OffsetMs int64  `json:"offsetMs"`
+}
+
+// handleGetPlayback reports a room's current synchronized-viewing offset
+// and play state.
+func handleGetPlayback(c *gin.Context, h *hub.Hub) {
+	offsetMs, playing := h.GetPlayback(c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"offsetMs": offsetMs, "playing": playing})
+}
+
+// handleSetPlayback applies a play/pause/seek action to a room's
+// synchronized-viewing clock and broadcasts the new state to the room.
+func handleSetPlayback(c *gin.Context, h *hub.Hub) {
+	var req playbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.SetPlayback(c.Param("id"), req.Action, req.OffsetMs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// defaultHistoryLimit caps how many messages a single /history request
+// returns when the client doesn't ask for a specific page size.
+const defaultHistoryLimit = 50
+
+// handleHistory serves a page of a room's persisted chat history, so a
+// reconnecting client can catch up without every message being replayed
+// over the socket. before/limit are optional query params; before defaults
+// to now, limit to defaultHistoryLimit.
+func handleHistory(c *gin.Context, h *hub.Hub) {
+	roomID := c.Param("id")
+
+	limit := defaultHistoryLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	before := time.Now()
+	if v := c.Query("before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before must be RFC3339"})
+			return
+		}
+		before = t
+	}
+
+	messages, err := h.GetHistory(roomID, limit, before)
+	if err != nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// performHandshake requires the client's first message to be a valid,
+// HMAC-signed hello within helloDeadline, assigns it a server-chosen
+// session ID in place of whatever userId it claimed, and replies with a
+// welcome carrying that ID. It returns false (and leaves the caller to
+// close conn) if the handshake fails.
+func performHandshake(conn *websocket.Conn, secret []byte, nonces *authtoken.NonceCache) (*models.User, bool) {
+	conn.SetReadDeadline(time.Now().Add(helloDeadline))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		logger.Errorf("hello read error: %v", err)
+		return nil, false
+	}
+
+	hello, err := authtoken.ParseHello(msg)
+	if err != nil {
+		logger.Errorf("invalid hello: %v", err)
+		return nil, false
+	}
+
+	if err := authtoken.Verify(secret, nonces, hello, time.Now()); err != nil {
+		logger.Errorf("hello rejected for user %s: %v", hello.UserID, err)
+		return nil, false
+	}
+
+	sessionID := uuid.New().String()
+	welcome, err := json.Marshal(authtoken.Welcome{Type: "welcome", SessionID: sessionID})
+	if err != nil {
+		logger.Errorf("marshal welcome: %v", err)
+		return nil, false
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, welcome); err != nil {
+		logger.Errorf("write welcome: %v", err)
+		return nil, false
+	}
+
+	logger.Infof("Session %s authenticated for user %s", sessionID, hello.UserID)
+	return &models.User{ID: sessionID, Username: hello.UserID}, true
+}
@@ -0,0 +1,46 @@
+package hub
+
+import (
+	"encoding/json"
+	"time"
+
+	"chatstreamapp/internal/models"
+	basehub "chatstreamapp/pkg/hub"
+
+	"github.com/google/uuid"
+)
+
+// DanmakuMessage is the payload carried by a KindDanmaku envelope: a bullet
+// comment timed to a point in the room's shared video playback, rendered by
+// clients as an overlay rather than a normal chat line.
+type DanmakuMessage struct {
+	RoomID           string `json:"roomId"`
+	Text             string `json:"text"`
+	PlaybackOffsetMs int64  `json:"playbackOffsetMs"`
+	Color            string `json:"color"`
+	Position         string `json:"position"`
+}
+
+// BroadcastDanmaku fans a bullet comment out to everyone in the room without
+// adding it to normal chat history.
+func (h *Hub) BroadcastDanmaku(d *DanmakuMessage) {
+	h.base.Room(d.RoomID).Broadcast(&basehub.Envelope{
+		Kind:    basehub.KindDanmaku,
+		RoomID:  d.RoomID,
+		Payload: d,
+	})
+}
+
+// danmakuToMessage wraps a danmaku payload as a models.Message so it can
+// travel over the existing Client.SendMessage path.
+func danmakuToMessage(d *DanmakuMessage) *models.Message {
+	content, _ := json.Marshal(d)
+	return &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypeDanmaku,
+		Content:   string(content),
+		Sender:    "danmaku",
+		Room:      d.RoomID,
+		Timestamp: time.Now(),
+	}
+}
@@ -3,12 +3,20 @@ package hub
 import (
 	"chatstreamapp/internal/logger"
 	"chatstreamapp/internal/models"
+	"chatstreamapp/internal/store"
+	basehub "chatstreamapp/pkg/hub"
+	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// historyPageSize caps how many past messages a joining client is replayed,
+// now that history can come from a store instead of an in-memory slice.
+const historyPageSize = 50
+
 // Client interface for hub to work with clients
 type Client interface {
 	SendMessage(message *models.Message)
@@ -46,8 +54,57 @@ type Hub struct {
 
 	// Mutex for thread safety
 	mu sync.RWMutex
+
+	// base tracks room membership (history lives in store or
+	// models.Room); broadcastToRoom delegates to it instead of
+	// hand-rolling its own fan-out loop.
+	base *basehub.Hub
+
+	// store persists messages across restarts. Nil falls back to the
+	// in-memory models.Room.Messages history used before it existed.
+	store store.MessageStore
+
+	// playback tracks each room's synchronized-viewing clock.
+	playback map[string]*PlaybackController
+}
+
+// clientTransport adapts a Client to basehub.Transport so the shared Room
+// can deliver chat envelopes without knowing how a client actually writes
+// to its socket. Deliver runs synchronously on whatever goroutine is
+// broadcasting (normally Hub.Run()), so it must never block: Client
+// implementations (e.g. wsClient) are expected to bound their own
+// SendMessage themselves rather than rely on a wrapper here, since wrapping
+// clientTransport in a second basehub.SlowConsumerTransport would just queue
+// on top of that bound without ever observing real socket backpressure.
+type clientTransport struct {
+	client Client
+}
+
+func (t *clientTransport) Deliver(env *basehub.Envelope) error {
+	switch env.Kind {
+	case basehub.KindChat:
+		msg, ok := env.Payload.(*models.Message)
+		if !ok {
+			return fmt.Errorf("chat transport: unexpected payload type %T for chat envelope", env.Payload)
+		}
+		t.client.SendMessage(msg)
+		return nil
+
+	case basehub.KindDanmaku:
+		d, ok := env.Payload.(*DanmakuMessage)
+		if !ok {
+			return fmt.Errorf("chat transport: unexpected payload type %T for danmaku envelope", env.Payload)
+		}
+		t.client.SendMessage(danmakuToMessage(d))
+		return nil
+
+	default:
+		return fmt.Errorf("chat transport: unsupported envelope kind %q", env.Kind)
+	}
 }
 
+func (t *clientTransport) Close() error { return nil }
+
 // PrivateMessage represents a private message to a specific user
 type PrivateMessage struct {
 	UserID  string
@@ -72,9 +129,79 @@ func NewHub() *Hub {
 		privateMessage: make(chan *PrivateMessage),
 		joinRoom:       make(chan *RoomOperation),
 		leaveRoom:      make(chan *RoomOperation),
+		base:           basehub.New(),
+		playback:       make(map[string]*PlaybackController),
 	}
 }
 
+// NewHubWithStore creates a Hub that persists messages to store before
+// fanning them out, and replays history from store on room join instead of
+// the in-memory models.Room.Messages slice.
+func NewHubWithStore(s store.MessageStore) *Hub {
+	h := NewHub()
+	h.store = s
+	return h
+}
+
+// NewClusteredHub creates a Hub whose rooms fan broadcasts and presence out
+// over bp, so a second replica of chat-server behind a load balancer still
+// delivers messages to users connected elsewhere. nodeID must be unique per
+// replica.
+func NewClusteredHub(nodeID string, bp basehub.Backplane) *Hub {
+	h := NewHub()
+	h.base = basehub.NewClustered(nodeID, bp, decodeChatPayload)
+	return h
+}
+
+// NewClusteredHubWithStore combines NewClusteredHub and NewHubWithStore, for
+// a clustered deployment backed by a shared store (e.g. Postgres) rather
+// than per-replica in-memory history.
+func NewClusteredHubWithStore(nodeID string, bp basehub.Backplane, s store.MessageStore) *Hub {
+	h := NewClusteredHub(nodeID, bp)
+	h.store = s
+	return h
+}
+
+// decodeChatPayload rehydrates the payload another replica published: a
+// *models.Message for a KindChat envelope, a *DanmakuMessage for a
+// KindDanmaku one.
+func decodeChatPayload(kind basehub.Kind, data []byte) (interface{}, error) {
+	switch kind {
+	case basehub.KindChat:
+		var msg models.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+	case basehub.KindDanmaku:
+		var d DanmakuMessage
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, err
+		}
+		return &d, nil
+	default:
+		return nil, fmt.Errorf("chat hub: unexpected envelope kind %q", kind)
+	}
+}
+
+// GetHistory returns up to limit messages posted to roomID before the given
+// time, for a REST handler to expose paginated history so a reconnecting
+// client can catch up without every message being replayed over the socket.
+// It returns an error if no store is configured.
+func (h *Hub) GetHistory(roomID string, limit int, before time.Time) ([]*models.Message, error) {
+	if h.store == nil {
+		return nil, fmt.Errorf("chat hub: no message store configured")
+	}
+	return h.store.Recent(roomID, limit, before)
+}
+
+// GetClusterUsers returns the user IDs present in roomID across the whole
+// cluster, merging this replica's local connections with presence
+// reconciled from other replicas over the backplane.
+func (h *Hub) GetClusterUsers(roomID string) []string {
+	return h.base.Room(roomID).MemberIDs()
+}
+
 // Run starts the hub
 func (h *Hub) Run() {
 	// Create a default general room
@@ -181,10 +308,10 @@ func (h *Hub) CreateRoom(name string) *models.Room {
 
 func (h *Hub) registerClient(client Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
 	h.clients[client] = true
 	h.userClients[client.GetUser().ID] = client
+	roomsList := h.getRoomsList()
+	h.mu.Unlock()
 
 	user := client.GetUser()
 	logger.Infof("User %s (%s) connected", user.Username, user.ID)
@@ -203,7 +330,7 @@ func (h *Hub) registerClient(client Client) {
 	roomsMessage := &models.Message{
 		ID:        uuid.New().String(),
 		Type:      models.MessageTypeSystem,
-		Content:   h.getRoomsList(),
+		Content:   roomsList,
 		Sender:    "System",
 		Timestamp: time.Now(),
 	}
@@ -212,95 +339,114 @@ func (h *Hub) registerClient(client Client) {
 
 func (h *Hub) unregisterClient(client Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
-	if _, ok := h.clients[client]; ok {
-		user := client.GetUser()
-		roomID := client.GetRoomID()
-
-		// Remove from room if in one
-		if roomID != "" {
-			if room, exists := h.rooms[roomID]; exists {
-				room.RemoveUser(user.ID)
-				
-				// Notify room about user leaving
-				leaveMessage := &models.Message{
-					ID:        uuid.New().String(),
-					Type:      models.MessageTypeLeave,
-					Content:   user.Username + " left the room",
-					Sender:    "System",
-					Room:      roomID,
-					Timestamp: time.Now(),
-				}
-				h.broadcastToRoom(roomID, leaveMessage)
-			}
+	_, ok := h.clients[client]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+
+	user := client.GetUser()
+	roomID := client.GetRoomID()
+
+	// Remove from room if in one
+	leftRoom := false
+	if roomID != "" {
+		if room, exists := h.rooms[roomID]; exists {
+			room.RemoveUser(user.ID)
+			h.base.Room(roomID).Leave(user.ID)
+			leftRoom = true
 		}
+	}
+
+	delete(h.clients, client)
+	delete(h.userClients, user.ID)
+
+	h.mu.Unlock()
 
-		delete(h.clients, client)
-		delete(h.userClients, user.ID)
-		
-		logger.Infof("User %s (%s) disconnected", user.Username, user.ID)
+	// Notify room about user leaving. This runs without h.mu held so a
+	// lagging member elsewhere in the room can't stall registration.
+	if leftRoom {
+		leaveMessage := &models.Message{
+			ID:        uuid.New().String(),
+			Type:      models.MessageTypeLeave,
+			Content:   user.Username + " left the room",
+			Sender:    "System",
+			Room:      roomID,
+			Timestamp: time.Now(),
+		}
+		h.broadcastToRoom(roomID, leaveMessage)
 	}
+
+	logger.Infof("User %s (%s) disconnected", user.Username, user.ID)
 }
 
+// broadcastMessage persists message (if a store is configured) and fans it
+// out to its room. The fan-out itself happens without h.mu held: Room
+// members are snapshotted and delivered to by pkg/hub, and a lagging member
+// is queued rather than written to synchronously, so a single slow socket
+// can't stall registration or other rooms' broadcasts.
 func (h *Hub) broadcastMessage(message *models.Message) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	if message.Room == "" {
+		return
+	}
 
-	if message.Room != "" {
-		// Add message to room history
+	if h.store != nil {
+		if err := h.store.Append(message.Room, message); err != nil {
+			logger.Errorf("persist message for room %s: %v", message.Room, err)
+			return
+		}
+	} else {
+		h.mu.Lock()
 		if room, exists := h.rooms[message.Room]; exists {
+			// No store configured: fall back to the in-memory history.
 			room.AddMessage(message)
 		}
-		
-		// Broadcast to room
-		h.broadcastToRoom(message.Room, message)
+		h.mu.Unlock()
 	}
+
+	h.broadcastToRoom(message.Room, message)
 }
 
 func (h *Hub) broadcastToRoom(roomID string, message *models.Message) {
-	room, exists := h.rooms[roomID]
+	h.mu.RLock()
+	_, exists := h.rooms[roomID]
+	h.mu.RUnlock()
 	if !exists {
 		return
 	}
 
-	for userID := range room.Users {
-		if client, exists := h.userClients[userID]; exists {
-			client.SendMessage(message)
-		}
-	}
+	h.base.Room(roomID).Broadcast(&basehub.Envelope{
+		Kind:    basehub.KindChat,
+		RoomID:  roomID,
+		From:    message.Sender,
+		Payload: message,
+	})
 }
 
 func (h *Hub) sendPrivateMessage(pm *PrivateMessage) {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	client, exists := h.userClients[pm.UserID]
+	h.mu.RUnlock()
 
-	if client, exists := h.userClients[pm.UserID]; exists {
+	if exists {
 		client.SendMessage(pm.Message)
 	}
 }
 
 func (h *Hub) handleJoinRoom(op *RoomOperation) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
 	user := op.Client.GetUser()
-	
+
 	// Leave current room if in one
 	currentRoom := op.Client.GetRoomID()
+	leftCurrentRoom := false
 	if currentRoom != "" {
 		if room, exists := h.rooms[currentRoom]; exists {
 			room.RemoveUser(user.ID)
-			
-			leaveMessage := &models.Message{
-				ID:        uuid.New().String(),
-				Type:      models.MessageTypeLeave,
-				Content:   user.Username + " left the room",
-				Sender:    "System",
-				Room:      currentRoom,
-				Timestamp: time.Now(),
-			}
-			h.broadcastToRoom(currentRoom, leaveMessage)
+			h.base.Room(currentRoom).Leave(user.ID)
+			leftCurrentRoom = true
 		}
 	}
 
@@ -315,6 +461,25 @@ func (h *Hub) handleJoinRoom(op *RoomOperation) {
 	room.AddUser(user)
 	user.Room = op.RoomID
 	op.Client.SetRoomID(op.RoomID)
+	h.base.Room(op.RoomID).Join(&basehub.Member{ID: user.ID, Transport: &clientTransport{client: op.Client}})
+
+	pc, hasPlayback := h.playback[op.RoomID]
+
+	h.mu.Unlock()
+
+	// Everything below only sends messages, so it runs without h.mu held:
+	// a lagging member can't stall registration or other rooms' traffic.
+	if leftCurrentRoom {
+		leaveMessage := &models.Message{
+			ID:        uuid.New().String(),
+			Type:      models.MessageTypeLeave,
+			Content:   user.Username + " left the room",
+			Sender:    "System",
+			Room:      currentRoom,
+			Timestamp: time.Now(),
+		}
+		h.broadcastToRoom(currentRoom, leaveMessage)
+	}
 
 	// Send join message to room
 	joinMessage := &models.Message{
@@ -328,8 +493,27 @@ func (h *Hub) handleJoinRoom(op *RoomOperation) {
 	h.broadcastToRoom(op.RoomID, joinMessage)
 
 	// Send room history to the joining user
-	for _, msg := range room.Messages {
-		op.Client.SendMessage(msg)
+	if h.store != nil {
+		recent, err := h.store.Recent(op.RoomID, historyPageSize, time.Now())
+		if err != nil {
+			logger.Errorf("load history for room %s: %v", op.RoomID, err)
+		} else {
+			// Recent returns newest-first; replay oldest-first like a
+			// normal conversation.
+			for i := len(recent) - 1; i >= 0; i-- {
+				op.Client.SendMessage(recent[i])
+			}
+		}
+	} else {
+		for _, msg := range room.Messages {
+			op.Client.SendMessage(msg)
+		}
+	}
+
+	// If the room has a synchronized-viewing session, tell the joining
+	// client where playback currently is so existing bullets line up.
+	if hasPlayback {
+		op.Client.SendMessage(syncMessage(op.RoomID, pc))
 	}
 
 	logger.Infof("User %s joined room %s", user.Username, op.RoomID)
@@ -337,15 +521,20 @@ func (h *Hub) handleJoinRoom(op *RoomOperation) {
 
 func (h *Hub) handleLeaveRoom(op *RoomOperation) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
 	user := op.Client.GetUser()
-	
-	if room, exists := h.rooms[op.RoomID]; exists {
-		room.RemoveUser(user.ID)
+
+	_, exists := h.rooms[op.RoomID]
+	if exists {
+		h.rooms[op.RoomID].RemoveUser(user.ID)
+		h.base.Room(op.RoomID).Leave(user.ID)
 		user.Room = ""
 		op.Client.SetRoomID("")
+	}
+
+	h.mu.Unlock()
 
+	if exists {
 		leaveMessage := &models.Message{
 			ID:        uuid.New().String(),
 			Type:      models.MessageTypeLeave,
@@ -0,0 +1,133 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"chatstreamapp/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// PlaybackController tracks one room's shared video playback clock, so
+// play/pause/seek actions stay in sync across everyone watching and a late
+// joiner can render existing bullets aligned to the timeline.
+type PlaybackController struct {
+	mu        sync.Mutex
+	playing   bool
+	offsetMs  int64
+	updatedAt time.Time
+}
+
+// NewPlaybackController returns a controller paused at offset zero.
+func NewPlaybackController() *PlaybackController {
+	return &PlaybackController{updatedAt: time.Now()}
+}
+
+// Offset returns the current playback offset, extrapolated forward from the
+// last play or seek event if the clock is running.
+func (p *PlaybackController) Offset() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.offsetLocked()
+}
+
+func (p *PlaybackController) offsetLocked() int64 {
+	if !p.playing {
+		return p.offsetMs
+	}
+	return p.offsetMs + time.Since(p.updatedAt).Milliseconds()
+}
+
+// Playing reports whether the clock is currently running.
+func (p *PlaybackController) Playing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.playing
+}
+
+// Play starts the clock running from offsetMs.
+func (p *PlaybackController) Play(offsetMs int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.offsetMs = offsetMs
+	p.updatedAt = time.Now()
+	p.playing = true
+}
+
+// Pause freezes the clock at its current extrapolated offset.
+func (p *PlaybackController) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.offsetMs = p.offsetLocked()
+	p.updatedAt = time.Now()
+	p.playing = false
+}
+
+// Seek jumps the clock to offsetMs without changing play/pause state.
+func (p *PlaybackController) Seek(offsetMs int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.offsetMs = offsetMs
+	p.updatedAt = time.Now()
+}
+
+// playbackController returns roomID's controller, creating it if needed.
+func (h *Hub) playbackController(roomID string) *PlaybackController {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pc, exists := h.playback[roomID]
+	if !exists {
+		pc = NewPlaybackController()
+		h.playback[roomID] = pc
+	}
+	return pc
+}
+
+// SetPlayback applies a play/pause/seek action to roomID's playback clock
+// and broadcasts the new state to the room as a models.MessageTypeSync
+// message, intended to back a REST `/rooms/:id/playback` PUT endpoint.
+func (h *Hub) SetPlayback(roomID, action string, offsetMs int64) error {
+	pc := h.playbackController(roomID)
+
+	switch action {
+	case "play":
+		pc.Play(offsetMs)
+	case "pause":
+		pc.Pause()
+	case "seek":
+		pc.Seek(offsetMs)
+	default:
+		return fmt.Errorf("playback hub: unknown action %q", action)
+	}
+
+	h.broadcastToRoom(roomID, syncMessage(roomID, pc))
+	return nil
+}
+
+// GetPlayback returns roomID's current playback offset and play state,
+// intended to back a REST `/rooms/:id/playback` GET endpoint.
+func (h *Hub) GetPlayback(roomID string) (offsetMs int64, playing bool) {
+	pc := h.playbackController(roomID)
+	return pc.Offset(), pc.Playing()
+}
+
+// syncMessage wraps a controller's current state as a models.Message so it
+// can travel the same room broadcast and join-replay paths as chat.
+func syncMessage(roomID string, pc *PlaybackController) *models.Message {
+	content, _ := json.Marshal(map[string]interface{}{
+		"offsetMs": pc.Offset(),
+		"playing":  pc.Playing(),
+	})
+	return &models.Message{
+		ID:        uuid.New().String(),
+		Type:      models.MessageTypeSync,
+		Content:   string(content),
+		Sender:    "System",
+		Room:      roomID,
+		Timestamp: time.Now(),
+	}
+}
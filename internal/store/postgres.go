@@ -0,0 +1,97 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"chatstreamapp/internal/models"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresStore persists room history to Postgres, for deployments running
+// more than one chat-server replica against shared storage.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore opens a connection pool against dsn and ensures the
+// messages table exists.
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres store: %w", err)
+	}
+
+	const schema = `
+	CREATE TABLE IF NOT EXISTS messages (
+		id        TEXT PRIMARY KEY,
+		room_id   TEXT NOT NULL,
+		sender    TEXT NOT NULL,
+		type      TEXT NOT NULL,
+		content   TEXT NOT NULL,
+		timestamp TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_messages_room_time ON messages(room_id, timestamp);
+	`
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("create messages table: %w", err)
+	}
+
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Append(roomID string, msg *models.Message) error {
+	_, err := s.db.Exec(
+		`INSERT INTO messages (id, room_id, sender, type, content, timestamp) VALUES ($1, $2, $3, $4, $5, $6)`,
+		msg.ID, roomID, msg.Sender, string(msg.Type), msg.Content, msg.Timestamp,
+	)
+	if err != nil {
+		return fmt.Errorf("append message: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Recent(roomID string, limit int, before time.Time) ([]*models.Message, error) {
+	rows, err := s.db.Query(
+		`SELECT id, sender, type, content, timestamp FROM messages
+		 WHERE room_id = $1 AND timestamp < $2
+		 ORDER BY timestamp DESC LIMIT $3`,
+		roomID, before, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query recent messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPostgresMessages(rows, roomID)
+}
+
+func (s *PostgresStore) Search(roomID, query string) ([]*models.Message, error) {
+	rows, err := s.db.Query(
+		`SELECT id, sender, type, content, timestamp FROM messages
+		 WHERE room_id = $1 AND content ILIKE $2 ORDER BY timestamp DESC`,
+		roomID, "%"+query+"%",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPostgresMessages(rows, roomID)
+}
+
+func scanPostgresMessages(rows *sql.Rows, roomID string) ([]*models.Message, error) {
+	var messages []*models.Message
+	for rows.Next() {
+		msg := &models.Message{Room: roomID}
+		var msgType string
+		if err := rows.Scan(&msg.ID, &msg.Sender, &msgType, &msg.Content, &msg.Timestamp); err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		msg.Type = models.MessageType(msgType)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"chatstreamapp/internal/models"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore persists room history to a single SQLite file, suitable for a
+// single-replica deployment or local development.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if necessary) the SQLite database at path
+// and ensures the messages table exists.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite store: %w", err)
+	}
+
+	const schema = `
+	CREATE TABLE IF NOT EXISTS messages (
+		id        TEXT PRIMARY KEY,
+		room_id   TEXT NOT NULL,
+		sender    TEXT NOT NULL,
+		type      TEXT NOT NULL,
+		content   TEXT NOT NULL,
+		timestamp DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_messages_room_time ON messages(room_id, timestamp);
+	`
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("create messages table: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Append(roomID string, msg *models.Message) error {
+	_, err := s.db.Exec(
+		`INSERT INTO messages (id, room_id, sender, type, content, timestamp) VALUES (?, ?, ?, ?, ?, ?)`,
+		msg.ID, roomID, msg.Sender, string(msg.Type), msg.Content, msg.Timestamp,
+	)
+	if err != nil {
+		return fmt.Errorf("append message: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Recent(roomID string, limit int, before time.Time) ([]*models.Message, error) {
+	rows, err := s.db.Query(
+		`SELECT id, sender, type, content, timestamp FROM messages
+		 WHERE room_id = ? AND timestamp < ?
+		 ORDER BY timestamp DESC LIMIT ?`,
+		roomID, before, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query recent messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows, roomID)
+}
+
+func (s *SQLiteStore) Search(roomID, query string) ([]*models.Message, error) {
+	rows, err := s.db.Query(
+		`SELECT id, sender, type, content, timestamp FROM messages
+		 WHERE room_id = ? AND content LIKE ? ORDER BY timestamp DESC`,
+		roomID, "%"+query+"%",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows, roomID)
+}
+
+func scanMessages(rows *sql.Rows, roomID string) ([]*models.Message, error) {
+	var messages []*models.Message
+	for rows.Next() {
+		msg := &models.Message{Room: roomID}
+		var msgType string
+		if err := rows.Scan(&msg.ID, &msg.Sender, &msgType, &msg.Content, &msg.Timestamp); err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		msg.Type = models.MessageType(msgType)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,21 @@
+// Package store defines the persistence backend for chat room history, so
+// messages survive a restart instead of living only in the in-process Hub.
+package store
+
+import (
+	"time"
+
+	"chatstreamapp/internal/models"
+)
+
+// MessageStore persists and retrieves a room's chat history. Recent and
+// Search return messages ordered newest-first.
+type MessageStore interface {
+	// Append persists msg as the latest message in roomID.
+	Append(roomID string, msg *models.Message) error
+	// Recent returns up to limit messages posted to roomID before the
+	// given time, newest first, for paginating backward through history.
+	Recent(roomID string, limit int, before time.Time) ([]*models.Message, error)
+	// Search returns every message in roomID whose content matches query.
+	Search(roomID, query string) ([]*models.Message, error)
+}
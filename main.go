@@ -4,14 +4,82 @@ import (
 	"chatstreamapp/internal/api"
 	"chatstreamapp/internal/hub"
 	"chatstreamapp/internal/logger"
+	"chatstreamapp/internal/store"
+	"chatstreamapp/pkg/authtoken"
+	basehub "chatstreamapp/pkg/hub"
+	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
+// messageStoreFromEnv builds the persistent message store selected by
+// CHAT_STORE_BACKEND ("sqlite" or "postgres"), or returns a nil store (ok
+// the in-memory history on models.Room) if it's unset.
+func messageStoreFromEnv() (store.MessageStore, error) {
+	switch backend := os.Getenv("CHAT_STORE_BACKEND"); backend {
+	case "":
+		return nil, nil
+
+	case "sqlite":
+		path := os.Getenv("CHAT_SQLITE_PATH")
+		if path == "" {
+			path = "chat.db"
+		}
+		return store.NewSQLiteStore(path)
+
+	case "postgres":
+		dsn := os.Getenv("CHAT_POSTGRES_DSN")
+		if dsn == "" {
+			return nil, fmt.Errorf("CHAT_POSTGRES_DSN must be set for CHAT_STORE_BACKEND=postgres")
+		}
+		return store.NewPostgresStore(dsn)
+
+	default:
+		return nil, fmt.Errorf("unknown CHAT_STORE_BACKEND %q", backend)
+	}
+}
+
 func main() {
-	// Initialize the WebSocket hub
-	chatHub := hub.NewHub()
+	helloSecret := os.Getenv("CHAT_HELLO_SECRET")
+	if helloSecret == "" {
+		logger.Errorf("CHAT_HELLO_SECRET must be set so clients can sign their hello handshake")
+		os.Exit(1)
+	}
+
+	messageStore, err := messageStoreFromEnv()
+	if err != nil {
+		logger.Errorf("configure message store: %v", err)
+		os.Exit(1)
+	}
+
+	// Initialize the WebSocket hub. If CLUSTER_BACKPLANE is configured,
+	// use a clustered hub so room membership and broadcasts are shared
+	// with other chat-server replicas, and room membership (not chat
+	// broadcasts) with video_service if it's pointed at the same backplane
+	// and room IDs. If CHAT_STORE_BACKEND is
+	// also configured, room history persists to it instead of living only
+	// in memory.
+	var chatHub *hub.Hub
+	bp, nodeID, clustered, err := basehub.BackplaneFromEnv()
+	if err != nil {
+		logger.Errorf("configure cluster backplane: %v", err)
+		os.Exit(1)
+	}
+	switch {
+	case clustered && messageStore != nil:
+		chatHub = hub.NewClusteredHubWithStore(nodeID, bp, messageStore)
+		logger.Infof("Clustered chat hub initialized (node %s) with persistent store", nodeID)
+	case clustered:
+		chatHub = hub.NewClusteredHub(nodeID, bp)
+		logger.Infof("Clustered chat hub initialized (node %s)", nodeID)
+	case messageStore != nil:
+		chatHub = hub.NewHubWithStore(messageStore)
+		logger.Info("Chat hub initialized with persistent store")
+	default:
+		chatHub = hub.NewHub()
+	}
 	go chatHub.Run()
 
 	// Setup Gin router
@@ -39,8 +107,11 @@ func main() {
 	router.Static("/static", "./web/static")
 	router.StaticFile("/", "./web/index.html")
 
-	// Initialize API routes
-	api.SetupRoutes(router, chatHub)
+	// Initialize API routes. nonces is per-process: if chatHub is clustered,
+	// a replayed hello landing on a different replica within the skew
+	// window isn't caught (see authtoken.NewNonceCache).
+	nonces := authtoken.NewNonceCache()
+	api.SetupRoutes(router, chatHub, []byte(helloSecret), nonces)
 
 	// Start server
 	logger.Info("Chat server starting on :8080")
@@ -0,0 +1,121 @@
+// Package authtoken implements the HMAC-signed "hello" handshake a client
+// must complete before a WebSocket connection is registered with a Hub, so a
+// peer can't simply claim any ID via a query string.
+package authtoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxClockSkew bounds how far a Hello's timestamp may drift from server
+// time before it's rejected as stale or replayed.
+const MaxClockSkew = 30 * time.Second
+
+// nonceTTL bounds how long a (userID, nonce) pair is remembered by a
+// NonceCache. It must be at least twice MaxClockSkew: a replayed hello can
+// carry any timestamp up to MaxClockSkew stale, so the cache has to
+// outlive the whole skew window on both sides to catch it.
+const nonceTTL = 2 * MaxClockSkew
+
+// NonceCache remembers recently seen (userID, nonce) pairs so Verify can
+// reject a hello that's replayed within the clock-skew window it would
+// otherwise still pass. It's safe for concurrent use.
+type NonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // "userID|nonce" -> expiry
+}
+
+// NewNonceCache returns an empty NonceCache. It is local to this process:
+// in a clustered deployment (see basehub.NewClustered), every replica
+// constructs its own, and a hello captured and replayed against a
+// *different* replica within MaxClockSkew is not caught, since claimed
+// nonces aren't shared across the cluster. Closing that gap would mean
+// routing claim through the same backplane used for room presence.
+func NewNonceCache() *NonceCache {
+	return &NonceCache{seen: make(map[string]time.Time)}
+}
+
+// claim records (userID, nonce) as used as of now and reports whether it
+// had already been claimed before expiring, i.e. whether this is a replay.
+// Expired entries are pruned opportunistically so the cache doesn't grow
+// without bound.
+func (c *NonceCache) claim(userID, nonce string, now time.Time) (replay bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, expiry := range c.seen {
+		if now.After(expiry) {
+			delete(c.seen, key)
+		}
+	}
+
+	key := userID + "|" + nonce
+	if expiry, ok := c.seen[key]; ok && now.Before(expiry) {
+		return true
+	}
+	c.seen[key] = now.Add(nonceTTL)
+	return false
+}
+
+// Hello is the first message a client must send on a new connection.
+type Hello struct {
+	UserID    string `json:"userId"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+	HMAC      string `json:"hmac"`
+}
+
+// Welcome is returned to a client after a successful Hello, carrying the
+// server-assigned session ID the client must use from then on instead of
+// the UserID it claimed.
+type Welcome struct {
+	Type      string `json:"type"`
+	SessionID string `json:"sessionId"`
+}
+
+// ParseHello decodes a client's first message as a Hello.
+func ParseHello(data []byte) (Hello, error) {
+	var h Hello
+	if err := json.Unmarshal(data, &h); err != nil {
+		return Hello{}, fmt.Errorf("parse hello: %w", err)
+	}
+	return h, nil
+}
+
+// Sign computes the HMAC a client must send for a Hello, over
+// userId|timestamp|nonce.
+func Sign(secret []byte, userID string, timestamp int64, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s|%d|%s", userID, timestamp, nonce)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks h's HMAC, timestamp and nonce against secret, nonces and
+// now, rejecting stale, replayed or forged hellos. nonces must be the same
+// NonceCache across every hello verified against secret, or a replay could
+// slip through by landing on an instance that hasn't seen it yet.
+func Verify(secret []byte, nonces *NonceCache, h Hello, now time.Time) error {
+	skew := now.Sub(time.Unix(h.Timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > MaxClockSkew {
+		return fmt.Errorf("hello timestamp outside allowed skew: %s", skew)
+	}
+
+	expected := Sign(secret, h.UserID, h.Timestamp, h.Nonce)
+	if !hmac.Equal([]byte(expected), []byte(h.HMAC)) {
+		return fmt.Errorf("hello hmac mismatch")
+	}
+
+	if nonces.claim(h.UserID, h.Nonce, now) {
+		return fmt.Errorf("hello nonce %q already used for user %s", h.Nonce, h.UserID)
+	}
+	return nil
+}
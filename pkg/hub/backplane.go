@@ -0,0 +1,65 @@
+package hub
+
+import "encoding/json"
+
+// Backplane is a cluster-wide publish/subscribe transport. It lets rooms on
+// different replicas of chat-server or video_service exchange events, so a
+// second replica behind a load balancer sees the same broadcasts and
+// presence as the replica a given client happens to be connected to.
+type Backplane interface {
+	// Publish sends data to every replica (including this one) subscribed
+	// to subject.
+	Publish(subject string, data []byte) error
+	// Subscribe delivers every message published to subject to fn, for as
+	// long as the Hub is running.
+	Subscribe(subject string, fn func(data []byte)) error
+}
+
+// PayloadDecoder reconstructs a concrete Payload value from the raw JSON a
+// remote replica published, keyed by Kind, so an envelope injected from the
+// backplane looks the same to a Transport as one broadcast in-process.
+type PayloadDecoder func(kind Kind, data []byte) (interface{}, error)
+
+// eventType discriminates what a clustered Room publishes on its subject: a
+// broadcast envelope, a presence change, or a request/reply pair used to
+// snapshot current membership when a room first subscribes.
+type eventType string
+
+const (
+	eventEnvelope eventType = "envelope"
+	eventPresence eventType = "presence"
+	// eventPresenceSync asks other replicas subscribed to a room's subject
+	// to reply with their local membership, so a freshly subscribed room
+	// doesn't have to wait for a future join/leave to learn about members
+	// already present on another replica.
+	eventPresenceSync eventType = "presenceSync"
+	// eventPresenceSnapshot is the reply to eventPresenceSync, carrying
+	// every member ID the replying replica currently knows about locally.
+	eventPresenceSnapshot eventType = "presenceSnapshot"
+)
+
+// wireEvent is the JSON form published on a room's backplane subject.
+// NodeID lets a receiving replica recognize and ignore its own
+// publications (loop suppression) instead of re-delivering them locally.
+type wireEvent struct {
+	Type   eventType `json:"type"`
+	NodeID string    `json:"nodeId"`
+
+	// populated when Type == eventEnvelope
+	Kind    Kind            `json:"kind,omitempty"`
+	RoomID  string          `json:"roomId,omitempty"`
+	From    string          `json:"from,omitempty"`
+	To      string          `json:"to,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// populated when Type == eventPresence
+	MemberID string `json:"memberId,omitempty"`
+	Joined   bool   `json:"joined,omitempty"`
+
+	// populated when Type == eventPresenceSnapshot
+	MemberIDs []string `json:"memberIds,omitempty"`
+}
+
+func roomSubject(roomID string) string {
+	return "hub.room." + roomID
+}
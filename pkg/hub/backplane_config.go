@@ -0,0 +1,58 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+)
+
+// BackplaneFromEnv builds a Backplane from CLUSTER_BACKPLANE ("nats" or
+// "redis") and its connection env var, so chat-server and video_service can
+// both be pointed at the same cluster config instead of each hand-rolling
+// its own connection setup. Running both services against the same
+// backplane and room ID naming is what lets a room carry both chat and
+// WebRTC signaling for the same participants even though they're separate
+// processes. ok is false (with a nil Backplane) if CLUSTER_BACKPLANE isn't
+// set, meaning the caller should run single-process.
+func BackplaneFromEnv() (bp Backplane, nodeID string, ok bool, err error) {
+	kind := os.Getenv("CLUSTER_BACKPLANE")
+	if kind == "" {
+		return nil, "", false, nil
+	}
+
+	nodeID = os.Getenv("CLUSTER_NODE_ID")
+	if nodeID == "" {
+		return nil, "", false, fmt.Errorf("CLUSTER_NODE_ID must be set when CLUSTER_BACKPLANE is configured")
+	}
+
+	switch kind {
+	case "nats":
+		url := os.Getenv("NATS_URL")
+		if url == "" {
+			url = nats.DefaultURL
+		}
+		conn, err := nats.Connect(url)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("connect to nats: %w", err)
+		}
+		bp, err := NewNATSBackplane(conn, nodeID)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("init nats backplane: %w", err)
+		}
+		return bp, nodeID, true, nil
+
+	case "redis":
+		addr := os.Getenv("REDIS_ADDR")
+		if addr == "" {
+			return nil, "", false, fmt.Errorf("REDIS_ADDR must be set for CLUSTER_BACKPLANE=redis")
+		}
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		return NewRedisBackplane(context.Background(), client), nodeID, true, nil
+
+	default:
+		return nil, "", false, fmt.Errorf("unknown CLUSTER_BACKPLANE %q", kind)
+	}
+}
@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// hubRoomsStream is the JetStream stream every room subject is captured
+// under, so Publish is durable instead of a fire-and-forget core NATS
+// publish: a replica that's briefly down doesn't lose events published to
+// a room's subject while it was unreachable, because its durable consumer
+// resumes from its last acknowledged position on reconnect.
+const hubRoomsStream = "HUB_ROOMS"
+
+// NATSBackplane publishes room events through a NATS JetStream connection,
+// one subject per room.
+type NATSBackplane struct {
+	conn      *nats.Conn
+	js        nats.JetStreamContext
+	durableID string
+}
+
+// NewNATSBackplane wraps an already-connected NATS client, ensuring the
+// shared JetStream stream for room subjects exists. durableID must be
+// stable across restarts of this replica (e.g. its cluster node ID): it
+// names the JetStream durable consumer each Subscribe creates, which is
+// what lets the replica pick up where it left off instead of only seeing
+// whatever happens to be published after it reconnects.
+func NewNATSBackplane(conn *nats.Conn, durableID string) (*NATSBackplane, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("init jetstream context: %w", err)
+	}
+
+	if _, err := js.AddStream(&nats.StreamConfig{
+		Name:     hubRoomsStream,
+		Subjects: []string{roomSubject("*")},
+	}); err != nil {
+		if _, infoErr := js.StreamInfo(hubRoomsStream); infoErr != nil {
+			return nil, fmt.Errorf("create %s stream: %w", hubRoomsStream, err)
+		}
+		// Another replica already created the stream; nothing more to do.
+	}
+
+	return &NATSBackplane{conn: conn, js: js, durableID: durableID}, nil
+}
+
+func (b *NATSBackplane) Publish(subject string, data []byte) error {
+	_, err := b.js.Publish(subject, data)
+	return err
+}
+
+func (b *NATSBackplane) Subscribe(subject string, fn func(data []byte)) error {
+	_, err := b.js.Subscribe(subject, func(msg *nats.Msg) {
+		fn(msg.Data)
+		msg.Ack()
+	}, nats.Durable(durableConsumerName(b.durableID, subject)), nats.ManualAck(), nats.DeliverAll())
+	return err
+}
+
+// durableConsumerName derives a JetStream durable consumer name from a
+// replica ID and subject. Durable names may only contain alphanumerics,
+// dashes and underscores, so "." and "*" (room subjects end in a room ID
+// or, for the stream's own subject filter, a wildcard) are replaced.
+func durableConsumerName(durableID, subject string) string {
+	r := strings.NewReplacer(".", "_", "*", "star", ">", "gt")
+	return r.Replace(durableID) + "_" + r.Replace(subject)
+}
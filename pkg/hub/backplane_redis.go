@@ -0,0 +1,37 @@
+package hub
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBackplane publishes room events through Redis pub/sub, one channel
+// per room.
+type RedisBackplane struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+// NewRedisBackplane wraps an already-connected Redis client. ctx bounds the
+// lifetime of subscriptions started via Subscribe.
+func NewRedisBackplane(ctx context.Context, client *redis.Client) *RedisBackplane {
+	return &RedisBackplane{client: client, ctx: ctx}
+}
+
+func (b *RedisBackplane) Publish(subject string, data []byte) error {
+	return b.client.Publish(b.ctx, subject, data).Err()
+}
+
+func (b *RedisBackplane) Subscribe(subject string, fn func(data []byte)) error {
+	sub := b.client.Subscribe(b.ctx, subject)
+	ch := sub.Channel()
+
+	go func() {
+		for msg := range ch {
+			fn([]byte(msg.Payload))
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package hub
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Watermarks configures when a member's outbound queue is considered
+// lagging and how aggressively to give up on it once it falls behind.
+type Watermarks struct {
+	High     int           // queue depth at which the member is marked lagging
+	Low      int           // queue depth at which it's considered healthy again
+	MaxDrops int           // drops tolerated within Window once lagging
+	Window   time.Duration
+}
+
+// DefaultWatermarks is a reasonable starting point for a chat or signaling
+// socket.
+var DefaultWatermarks = Watermarks{High: 256, Low: 64, MaxDrops: 50, Window: 10 * time.Second}
+
+// SlowConsumerTransport wraps a Transport with a bounded outbound queue so a
+// member that can't keep up never blocks the goroutine broadcasting to a
+// Room. Deliver never blocks: once the queue is full the envelope is dropped
+// and counted against the member instead. If drops keep happening past
+// MaxDrops within Window while the member is lagging, onSlowConsumer fires
+// once so the caller can forcibly disconnect it, the same policy Galene's
+// webClient applies when a client falls behind on writes.
+type SlowConsumerTransport struct {
+	inner          Transport
+	wm             Watermarks
+	onSlowConsumer func()
+
+	queue chan *Envelope
+	done  chan struct{}
+
+	mu        sync.Mutex
+	lagging   bool
+	drops     int
+	windowEnd time.Time
+	tripped   bool
+}
+
+// NewSlowConsumerTransport starts a writer goroutine draining into inner and
+// returns the wrapped transport. Close stops that goroutine.
+func NewSlowConsumerTransport(inner Transport, wm Watermarks, onSlowConsumer func()) *SlowConsumerTransport {
+	t := &SlowConsumerTransport{
+		inner:          inner,
+		wm:             wm,
+		onSlowConsumer: onSlowConsumer,
+		queue:          make(chan *Envelope, wm.High),
+		done:           make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func (t *SlowConsumerTransport) run() {
+	for {
+		select {
+		case env := <-t.queue:
+			if err := t.inner.Deliver(env); err != nil {
+				return
+			}
+			t.noteDepth()
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Deliver enqueues env without blocking. If the queue is full it's dropped
+// and counted instead of stalling the caller.
+func (t *SlowConsumerTransport) Deliver(env *Envelope) error {
+	select {
+	case t.queue <- env:
+		t.noteDepth()
+		return nil
+	default:
+		t.noteDrop()
+		return fmt.Errorf("slow consumer transport: queue full, dropped envelope")
+	}
+}
+
+func (t *SlowConsumerTransport) noteDepth() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	depth := len(t.queue)
+	if depth >= t.wm.High {
+		t.lagging = true
+	} else if depth <= t.wm.Low {
+		t.lagging = false
+		t.drops = 0
+	}
+}
+
+func (t *SlowConsumerTransport) noteDrop() {
+	t.mu.Lock()
+	now := time.Now()
+	if now.After(t.windowEnd) {
+		t.drops = 0
+		t.windowEnd = now.Add(t.wm.Window)
+	}
+	t.drops++
+	trip := t.lagging && t.drops > t.wm.MaxDrops && !t.tripped
+	if trip {
+		t.tripped = true
+	}
+	t.mu.Unlock()
+
+	if trip && t.onSlowConsumer != nil {
+		t.onSlowConsumer()
+	}
+}
+
+// Close stops the writer goroutine and closes the wrapped transport. Safe to
+// call more than once.
+func (t *SlowConsumerTransport) Close() error {
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
+	return t.inner.Close()
+}
@@ -0,0 +1,28 @@
+package hub
+
+// Kind discriminates what an Envelope's Payload carries.
+type Kind string
+
+const (
+	// KindChat envelopes carry a chat message. The chat hub persists these
+	// itself (via its MessageStore) before broadcasting; Room doesn't keep
+	// its own history.
+	KindChat Kind = "chat"
+	// KindSignal envelopes carry a WebRTC signaling payload and are not
+	// persisted.
+	KindSignal Kind = "signal"
+	// KindDanmaku envelopes carry a bullet-chat overlay comment tied to a
+	// video playback offset; like signaling, they are not persisted.
+	KindDanmaku Kind = "danmaku"
+)
+
+// Envelope is the unit broadcast or delivered through a Room. Payload holds
+// the actual domain object (e.g. *models.Message for chat); callers type-
+// assert it based on Kind.
+type Envelope struct {
+	Kind    Kind
+	RoomID  string
+	From    string
+	To      string
+	Payload interface{}
+}
@@ -0,0 +1,179 @@
+// Package hub provides the transport-agnostic room primitive shared by the
+// chat server and the video signaling service, so both can dispatch typed
+// Envelopes through the same membership bookkeeping instead of
+// each maintaining its own register/unregister/broadcast machinery.
+package hub
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Hub owns a registry of rooms, each identified by its room ID. When
+// created with NewClustered, every room it hands out publishes its
+// broadcasts and presence changes on the backplane so other replicas stay
+// in sync.
+type Hub struct {
+	mu    sync.RWMutex
+	rooms map[string]*Room
+
+	nodeID    string
+	backplane Backplane
+	decode    PayloadDecoder
+}
+
+// New creates a single-process Hub with no cluster backplane.
+func New() *Hub {
+	return &Hub{rooms: make(map[string]*Room)}
+}
+
+// NewClustered creates a Hub whose rooms are kept in sync with other
+// replicas through bp. nodeID must be unique per replica so a replica can
+// recognize (and ignore) its own publications coming back over the
+// backplane. decode rehydrates a Payload from the raw JSON another replica
+// published, based on Kind.
+func NewClustered(nodeID string, bp Backplane, decode PayloadDecoder) *Hub {
+	return &Hub{
+		rooms:     make(map[string]*Room),
+		nodeID:    nodeID,
+		backplane: bp,
+		decode:    decode,
+	}
+}
+
+// Room returns the room for id, creating it if it doesn't exist yet. For a
+// clustered Hub, creation also subscribes the room to its backplane subject.
+func (h *Hub) Room(id string) *Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r, ok := h.rooms[id]; ok {
+		return r
+	}
+
+	r := newRoom(id)
+	h.rooms[id] = r
+
+	if h.backplane != nil {
+		h.wireCluster(r)
+	}
+	return r
+}
+
+// wireCluster attaches r's publish hooks and subscribes it to its backplane
+// subject so envelopes and presence changes from other replicas get
+// reconciled into r.
+func (h *Hub) wireCluster(r *Room) {
+	subject := roomSubject(r.ID)
+
+	r.publishEnvelope = func(env *Envelope) {
+		payload, err := json.Marshal(env.Payload)
+		if err != nil {
+			return
+		}
+		data, err := json.Marshal(wireEvent{
+			Type: eventEnvelope, NodeID: h.nodeID,
+			Kind: env.Kind, RoomID: env.RoomID, From: env.From, To: env.To,
+			Payload: payload,
+		})
+		if err != nil {
+			return
+		}
+		h.backplane.Publish(subject, data)
+	}
+
+	r.publishPresence = func(memberID string, joined bool) {
+		data, err := json.Marshal(wireEvent{
+			Type: eventPresence, NodeID: h.nodeID,
+			MemberID: memberID, Joined: joined,
+		})
+		if err != nil {
+			return
+		}
+		h.backplane.Publish(subject, data)
+	}
+
+	h.backplane.Subscribe(subject, func(data []byte) {
+		h.injectRemote(r, data)
+	})
+
+	// A room only learns about presence changes published after it
+	// subscribes, so a freshly started (or restarted) replica would
+	// otherwise under-report members already connected to other replicas
+	// until one of them happens to join or leave again. Ask for a
+	// snapshot of whoever's already there instead of waiting.
+	h.requestPresenceSync(r)
+}
+
+// injectRemote applies an event published on the backplane to the local
+// room, ignoring anything this node published itself.
+func (h *Hub) injectRemote(r *Room, data []byte) {
+	var evt wireEvent
+	if err := json.Unmarshal(data, &evt); err != nil {
+		return
+	}
+	if evt.NodeID == h.nodeID {
+		return // loop suppression
+	}
+
+	switch evt.Type {
+	case eventPresence:
+		r.reconcilePresence(evt.MemberID, evt.Joined)
+	case eventPresenceSync:
+		h.replyPresenceSnapshot(r)
+	case eventPresenceSnapshot:
+		for _, id := range evt.MemberIDs {
+			r.reconcilePresence(id, true)
+		}
+	case eventEnvelope:
+		payload, err := h.decode(evt.Kind, evt.Payload)
+		if err != nil {
+			return
+		}
+		r.deliverLocal(&Envelope{Kind: evt.Kind, RoomID: evt.RoomID, From: evt.From, To: evt.To, Payload: payload})
+	}
+}
+
+// requestPresenceSync asks other replicas subscribed to r's subject to
+// reply with their local membership, so r's cluster presence view is
+// populated immediately instead of waiting on a future join/leave.
+func (h *Hub) requestPresenceSync(r *Room) {
+	data, err := json.Marshal(wireEvent{Type: eventPresenceSync, NodeID: h.nodeID})
+	if err != nil {
+		return
+	}
+	h.backplane.Publish(roomSubject(r.ID), data)
+}
+
+// replyPresenceSnapshot publishes this replica's local membership for r in
+// response to a requestPresenceSync, so a replica that just (re)subscribed
+// can populate its cluster presence view without waiting for a future
+// join/leave. It's a no-op if this replica has no local members in r.
+func (h *Hub) replyPresenceSnapshot(r *Room) {
+	members := r.Members()
+	if len(members) == 0 {
+		return
+	}
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.ID
+	}
+
+	data, err := json.Marshal(wireEvent{Type: eventPresenceSnapshot, NodeID: h.nodeID, MemberIDs: ids})
+	if err != nil {
+		return
+	}
+	h.backplane.Publish(roomSubject(r.ID), data)
+}
+
+// Rooms returns a snapshot of every room currently known to the hub.
+func (h *Hub) Rooms() map[string]*Room {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rooms := make(map[string]*Room, len(h.rooms))
+	for id, r := range h.rooms {
+		rooms[id] = r
+	}
+	return rooms
+}
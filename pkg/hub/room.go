@@ -0,0 +1,160 @@
+package hub
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Member is a single participant attached to a Room via some Transport.
+type Member struct {
+	ID        string
+	Transport Transport
+}
+
+// Room owns membership for one room ID. It is payload-agnostic: callers
+// decide what an Envelope's Payload means via its Kind, and are responsible
+// for persisting it themselves if it needs to outlive the broadcast (e.g.
+// the chat hub's MessageStore).
+type Room struct {
+	ID string
+
+	mu      sync.RWMutex
+	members map[string]*Member
+
+	// remote holds IDs of members known to be present on other replicas,
+	// reconciled via the backplane so Members/MemberIDs return a merged
+	// cluster view even though only local members have a Transport here.
+	remote map[string]bool
+
+	// publishEnvelope/publishPresence are set by Hub when the room is
+	// clustered; nil for a single-process Hub.
+	publishEnvelope func(*Envelope)
+	publishPresence func(memberID string, joined bool)
+}
+
+func newRoom(id string) *Room {
+	return &Room{
+		ID:      id,
+		members: make(map[string]*Member),
+		remote:  make(map[string]bool),
+	}
+}
+
+// Join attaches a member to the room, replacing (and closing the transport
+// of) any existing member with the same ID, and announces the join to other
+// replicas if clustered.
+func (r *Room) Join(m *Member) {
+	r.mu.Lock()
+	old, existed := r.members[m.ID]
+	r.members[m.ID] = m
+	publish := r.publishPresence
+	r.mu.Unlock()
+
+	if existed {
+		old.Transport.Close()
+	}
+	if publish != nil {
+		publish(m.ID, true)
+	}
+}
+
+// Leave detaches a member from the room, closes its Transport, and
+// announces the departure to other replicas if clustered.
+func (r *Room) Leave(id string) {
+	r.mu.Lock()
+	m, existed := r.members[id]
+	delete(r.members, id)
+	publish := r.publishPresence
+	r.mu.Unlock()
+
+	if existed {
+		m.Transport.Close()
+	}
+	if publish != nil {
+		publish(id, false)
+	}
+}
+
+// Members returns a snapshot of local members currently in the room. Use
+// MemberIDs for a cluster-wide presence view.
+func (r *Room) Members() []*Member {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := make([]*Member, 0, len(r.members))
+	for _, m := range r.members {
+		members = append(members, m)
+	}
+	return members
+}
+
+// MemberIDs returns every member ID known to be in the room, whether
+// attached locally or reconciled from another replica via the backplane.
+func (r *Room) MemberIDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.members)+len(r.remote))
+	for id := range r.members {
+		ids = append(ids, id)
+	}
+	for id := range r.remote {
+		if _, local := r.members[id]; !local {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// reconcilePresence applies a presence change observed from another
+// replica.
+func (r *Room) reconcilePresence(memberID string, joined bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if joined {
+		r.remote[memberID] = true
+	} else {
+		delete(r.remote, memberID)
+	}
+}
+
+// Broadcast fans an envelope out to every local member and, if clustered,
+// publishes it for other replicas to deliver to theirs.
+func (r *Room) Broadcast(env *Envelope) {
+	r.deliverLocal(env)
+
+	r.mu.RLock()
+	publish := r.publishEnvelope
+	r.mu.RUnlock()
+	if publish != nil {
+		publish(env)
+	}
+}
+
+// deliverLocal fans an envelope out to local members only, without
+// publishing to the backplane. It's used both by Broadcast and to inject
+// envelopes received from other replicas, where re-publishing would loop.
+func (r *Room) deliverLocal(env *Envelope) {
+	r.mu.RLock()
+	members := make([]*Member, 0, len(r.members))
+	for _, m := range r.members {
+		members = append(members, m)
+	}
+	r.mu.RUnlock()
+
+	for _, m := range members {
+		m.Transport.Deliver(env)
+	}
+}
+
+// SendTo delivers an envelope to a single member by ID, e.g. for signaling
+// offers/answers that shouldn't fan out to the whole room.
+func (r *Room) SendTo(id string, env *Envelope) error {
+	r.mu.RLock()
+	m, ok := r.members[id]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("member %s not in room %s", id, r.ID)
+	}
+	return m.Transport.Deliver(env)
+}
@@ -0,0 +1,9 @@
+package hub
+
+// Transport delivers a single Envelope to one member. WebSocket is the only
+// implementation today, but Room never touches gorilla directly, so a
+// future transport only needs to satisfy this interface.
+type Transport interface {
+	Deliver(env *Envelope) error
+	Close() error
+}
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"chatstreamapp/pkg/authtoken"
 	"chatstreamapp/video_service/internal/hub"
 	"chatstreamapp/video_service/internal/logger"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -14,29 +17,53 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
+// helloDeadline bounds how long a newly-upgraded connection has to send its
+// hello before it's dropped.
+const helloDeadline = 5 * time.Second
+
 // signaling request structure
 type SignalPayload struct {
-	From string          `json:"from"`
-	To   string          `json:"to"`
-	Type string          `json:"type"`
-	Data json.RawMessage `json:"data"`
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Type   string          `json:"type"`
+	Room   string          `json:"room,omitempty"`
+	Target string          `json:"target,omitempty"` // publisher clientID, for "subscribe"
+	Data   json.RawMessage `json:"data"`
 }
 
-func SetupRoutes(r *gin.Engine, h *hub.Hub) {
-	r.GET("/ws", func(c *gin.Context) {
-		id := c.Query("id")
-		if id == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "missing id"})
-			return
-		}
+// sdpPayload is the shape of Data for publish/subscribe/answer exchanges.
+type sdpPayload struct {
+	SDP string `json:"sdp"`
+}
+
+func sendSDP(client *hub.Client, msgType, sdp string) {
+	env, err := hub.MarshalSignalEnvelope(client.ID, msgType, sdpPayload{SDP: sdp})
+	if err != nil {
+		logger.Errorf("marshal signaling envelope: %v", err)
+		return
+	}
+	client.TrySend(env)
+}
 
+// SetupRoutes wires the signaling WebSocket route. secret is the shared HMAC
+// key clients must sign their hello handshake with, and nonces tracks used
+// nonces so a captured hello can't be replayed within the clock-skew
+// window.
+func SetupRoutes(r *gin.Engine, h *hub.Hub, secret []byte, nonces *authtoken.NonceCache) {
+	r.GET("/ws", func(c *gin.Context) {
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			logger.Errorf("websocket upgrade error: %v", err)
 			return
 		}
 
-		client := &hub.Client{Conn: conn, Send: make(chan []byte, 256), ID: id}
+		sessionID, ok := performHandshake(conn, secret, nonces)
+		if !ok {
+			conn.Close()
+			return
+		}
+
+		client := hub.NewClient(h, conn, sessionID)
 		h.Register <- client
 
 		// read loop
@@ -56,18 +83,46 @@ func SetupRoutes(r *gin.Engine, h *hub.Hub) {
 					logger.Errorf("invalid payload: %v", err)
 					continue
 				}
-				// forward to target
-				logger.Infof("Received signaling message: from=%s to=%s type=%s", payload.From, payload.To, payload.Type)
-				h.Broadcast <- hub.Message{From: payload.From, To: payload.To, Type: payload.Type, Data: payload.Data}
-			}
-		}()
+				logger.Infof("Received signaling message: from=%s to=%s type=%s", client.ID, payload.To, payload.Type)
 
-		// write loop
-		go func() {
-			for data := range client.Send {
-				if err := client.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
-					logger.Errorf("write error: %v", err)
-					break
+				switch payload.Type {
+				case hub.PublishMsg:
+					var sdp sdpPayload
+					if err := json.Unmarshal(payload.Data, &sdp); err != nil {
+						logger.Errorf("invalid publish payload: %v", err)
+						continue
+					}
+					answer, err := h.Publish(client.ID, payload.Room, sdp.SDP)
+					if err != nil {
+						logger.Errorf("publish failed: %v", err)
+						continue
+					}
+					sendSDP(client, hub.AnswerMsg, answer)
+
+				case hub.SubscribeMsg:
+					offer, err := h.Subscribe(client.ID, payload.Target, payload.Room)
+					if err != nil {
+						logger.Errorf("subscribe failed: %v", err)
+						continue
+					}
+					sendSDP(client, hub.OfferMsg, offer)
+
+				case hub.AnswerMsg:
+					var sdp sdpPayload
+					if err := json.Unmarshal(payload.Data, &sdp); err != nil {
+						logger.Errorf("invalid answer payload: %v", err)
+						continue
+					}
+					if err := h.SubscribeAnswer(client.ID, payload.Room, sdp.SDP); err != nil {
+						logger.Errorf("subscribe answer failed: %v", err)
+					}
+
+				case hub.UnpublishMsg:
+					h.Unpublish(client.ID, payload.Room)
+
+				default:
+					// forward to target
+					h.Broadcast <- hub.Message{From: client.ID, To: payload.To, Type: payload.Type, Data: payload.Data}
 				}
 			}
 		}()
@@ -76,3 +131,44 @@ func SetupRoutes(r *gin.Engine, h *hub.Hub) {
 	// health
 	r.GET("/healthz", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
 }
+
+// performHandshake requires the client's first message to be a valid,
+// HMAC-signed hello within helloDeadline, assigns it a server-chosen
+// session ID in place of whatever userId it claimed, and replies with a
+// welcome carrying that ID. It returns false (and leaves the caller to
+// close conn) if the handshake fails.
+func performHandshake(conn *websocket.Conn, secret []byte, nonces *authtoken.NonceCache) (string, bool) {
+	conn.SetReadDeadline(time.Now().Add(helloDeadline))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		logger.Errorf("hello read error: %v", err)
+		return "", false
+	}
+
+	hello, err := authtoken.ParseHello(msg)
+	if err != nil {
+		logger.Errorf("invalid hello: %v", err)
+		return "", false
+	}
+
+	if err := authtoken.Verify(secret, nonces, hello, time.Now()); err != nil {
+		logger.Errorf("hello rejected for user %s: %v", hello.UserID, err)
+		return "", false
+	}
+
+	sessionID := uuid.New().String()
+	welcome, err := json.Marshal(authtoken.Welcome{Type: "welcome", SessionID: sessionID})
+	if err != nil {
+		logger.Errorf("marshal welcome: %v", err)
+		return "", false
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, welcome); err != nil {
+		logger.Errorf("write welcome: %v", err)
+		return "", false
+	}
+
+	logger.Infof("Session %s authenticated for user %s", sessionID, hello.UserID)
+	return sessionID, true
+}
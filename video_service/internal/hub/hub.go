@@ -2,11 +2,15 @@ package hub
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
+	"time"
 
+	basehub "chatstreamapp/pkg/hub"
 	"chatstreamapp/video_service/internal/logger"
 
 	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
 )
 
 // Message types for signaling
@@ -15,22 +19,156 @@ const (
 	AnswerMsg = "answer"
 	IceMsg    = "ice"
 	JoinMsg   = "join"
+
+	// SFU message types: a publisher pushes media in, subscribers pull
+	// each publisher's tracks back out.
+	PublishMsg      = "publish"
+	SubscribeMsg    = "subscribe"
+	UnpublishMsg    = "unpublish"
+	TrackAddedMsg   = "trackAdded"
+	TrackRemovedMsg = "trackRemoved"
 )
 
-// Client represents a single WebSocket connection for signaling
+// connTransport adapts a raw WebSocket connection to basehub.Transport, so a
+// Client's outbound writes go through basehub.SlowConsumerTransport's bounded
+// queue instead of hitting the socket directly.
+type connTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *connTransport) Deliver(env *basehub.Envelope) error {
+	data, ok := env.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("conn transport: unexpected payload type %T", env.Payload)
+	}
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (t *connTransport) Close() error { return nil }
+
+// Client represents a single WebSocket connection for signaling. Writes go
+// through a basehub.SlowConsumerTransport, so a slow reader can never block
+// the hub goroutine that's trying to deliver to it.
 type Client struct {
 	Conn *websocket.Conn
-	Send chan []byte
 	ID   string
+
+	transport *basehub.SlowConsumerTransport
+}
+
+// NewClient returns a Client ready to register with h, its outbound writes
+// wrapped in a SlowConsumerTransport that disconnects it as a slow consumer
+// if it falls too far behind.
+func NewClient(h *Hub, conn *websocket.Conn, id string) *Client {
+	c := &Client{Conn: conn, ID: id}
+	c.transport = basehub.NewSlowConsumerTransport(&connTransport{conn: conn}, basehub.DefaultWatermarks, func() {
+		logger.Errorf("client %s exceeded drop threshold, disconnecting as slow consumer", id)
+		h.Disconnect(c, "SLOW_CONSUMER")
+	})
+	return c
+}
+
+// TrySend enqueues data for delivery without blocking.
+func (c *Client) TrySend(data []byte) {
+	c.transport.Deliver(&basehub.Envelope{Payload: data})
+}
+
+// room holds the SFU state for a single call: one PeerConnection per
+// publisher ingesting tracks, and one PeerConnection per subscriber that
+// those tracks get re-forwarded to. Keeping this per-room (rather than one
+// global mesh) is what avoids the N^2 connection count of pure broadcast
+// signaling. presence is the shared pkg/hub.Room used to announce
+// trackAdded/trackRemoved to everyone in the call.
+type room struct {
+	publishers  map[string]*webrtc.PeerConnection        // publisher clientID -> ingest PC
+	tracks      map[string][]*webrtc.TrackLocalStaticRTP // publisher clientID -> forwarded tracks
+	subscribers map[string]*webrtc.PeerConnection         // subscriber clientID -> forwarding PC
+	senders     map[string]map[string]*webrtc.RTPSender   // subscriber clientID -> track ID -> sender on that subscriber's PC
+	presence    *basehub.Room
+}
+
+func newRoom(presence *basehub.Room) *room {
+	return &room{
+		publishers:  make(map[string]*webrtc.PeerConnection),
+		tracks:      make(map[string][]*webrtc.TrackLocalStaticRTP),
+		subscribers: make(map[string]*webrtc.PeerConnection),
+		senders:     make(map[string]map[string]*webrtc.RTPSender),
+		presence:    presence,
+	}
 }
 
 // Hub maintains active clients and broadcasts messages
 type Hub struct {
 	clients    map[string]*Client
+	rooms      map[string]*room
 	mu         sync.RWMutex
 	Register   chan *Client
 	Unregister chan *Client
 	Broadcast  chan Message
+
+	// base tracks call presence so track lifecycle events can be
+	// announced through the same Room abstraction the chat hub uses. When
+	// created with NewClusteredHub, it also carries presence across the
+	// backplane, so a room ID shared with chat-server (pointed at the
+	// same backplane) reflects participants connected to either service.
+	base *basehub.Hub
+}
+
+// signalTransport adapts a signaling Client to basehub.Transport by pushing
+// onto its existing outbound transport, so envelope delivery goes through
+// the same SlowConsumerTransport as every other signaling message. A client
+// that exceeds its drop threshold is disconnected as a slow consumer
+// automatically, by the callback NewClient wired up.
+type signalTransport struct {
+	client *Client
+}
+
+func (t *signalTransport) Deliver(env *basehub.Envelope) error {
+	evt, ok := env.Payload.(trackEvent)
+	if !ok {
+		return fmt.Errorf("signal transport: unexpected payload type %T", env.Payload)
+	}
+	data, err := MarshalSignalEnvelope("", evt.Type, trackEventData{PublisherID: evt.PublisherID, TrackID: evt.TrackID})
+	if err != nil {
+		return err
+	}
+	t.client.TrySend(data)
+	return nil
+}
+
+func (t *signalTransport) Close() error { return nil }
+
+// trackEvent is the Payload carried by trackAdded/trackRemoved envelopes
+// broadcast through a room's presence, including over the cluster backplane
+// (see decodeTrackEvent).
+type trackEvent struct {
+	Type        string `json:"type"`
+	PublisherID string `json:"publisherId"`
+	TrackID     string `json:"trackId"`
+}
+
+// trackEventData is the "data" field of a trackAdded/trackRemoved envelope
+// sent to a client, mirroring sdpPayload's role for offer/answer messages.
+type trackEventData struct {
+	PublisherID string `json:"publisherId"`
+	TrackID     string `json:"trackId"`
+}
+
+// MarshalSignalEnvelope wraps payload in the {"from","to","type","data"}
+// shape every signaling message is sent to a client in, so SDP exchanges and
+// track lifecycle events share one wire format. to is the intended
+// recipient's client ID, or "" for a room-wide broadcast.
+func MarshalSignalEnvelope(to, msgType string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"from": "sfu",
+		"to":   to,
+		"type": msgType,
+		"data": json.RawMessage(data),
+	})
 }
 
 // Message is a simple signaling message wrapper
@@ -44,10 +182,36 @@ type Message struct {
 func NewHub() *Hub {
 	return &Hub{
 		clients:    make(map[string]*Client),
+		rooms:      make(map[string]*room),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		Broadcast:  make(chan Message),
+		base:       basehub.New(),
+	}
+}
+
+// NewClusteredHub creates a Hub whose SFU rooms announce presence and track
+// lifecycle events over bp instead of staying local to this process, so a
+// room ID shared with a chat-server replica pointed at the same backplane
+// shows the same participants on both sides. nodeID must be unique per
+// replica.
+func NewClusteredHub(nodeID string, bp basehub.Backplane) *Hub {
+	h := NewHub()
+	h.base = basehub.NewClustered(nodeID, bp, decodeTrackEvent)
+	return h
+}
+
+// decodeTrackEvent rehydrates a trackEvent from the JSON another replica
+// published for a KindSignal envelope.
+func decodeTrackEvent(kind basehub.Kind, data []byte) (interface{}, error) {
+	if kind != basehub.KindSignal {
+		return nil, fmt.Errorf("video hub: unexpected envelope kind %q", kind)
 	}
+	var evt trackEvent
+	if err := json.Unmarshal(data, &evt); err != nil {
+		return nil, err
+	}
+	return evt, nil
 }
 
 func (h *Hub) Run() {
@@ -57,39 +221,349 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			h.clients[client.ID] = client
 			h.mu.Unlock()
+
 		case client := <-h.Unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client.ID]; ok {
-				delete(h.clients, client.ID)
-				close(client.Send)
-			}
+			pending := h.unregisterLocked(client)
 			h.mu.Unlock()
+			for _, announce := range pending {
+				announce()
+			}
+
 		case msg := <-h.Broadcast:
 			h.mu.RLock()
-			if to, ok := h.clients[msg.To]; ok {
-				// Add forwarding log here
-				// Use logger.Infof from the logger package
-				logger.Infof("Forwarding signaling message: from=%s to=%s type=%s", msg.From, msg.To, msg.Type)
-				// Send the full message structure, not just the data
-				fullMsg := map[string]interface{}{
-					"from": msg.From,
-					"to":   msg.To,
-					"type": msg.Type,
-					"data": json.RawMessage(msg.Data),
-				}
-				msgBytes, err := json.Marshal(fullMsg)
-				if err != nil {
-					logger.Errorf("Failed to marshal message: %v", err)
-					h.mu.RUnlock()
-					continue
-				}
-				select {
-				case to.Send <- msgBytes:
-				default:
-					// drop if not ready
-				}
-			}
+			to, ok := h.clients[msg.To]
 			h.mu.RUnlock()
+			if !ok {
+				continue
+			}
+
+			logger.Infof("Forwarding signaling message: from=%s to=%s type=%s", msg.From, msg.To, msg.Type)
+			fullMsg := map[string]interface{}{
+				"from": msg.From,
+				"to":   msg.To,
+				"type": msg.Type,
+				"data": json.RawMessage(msg.Data),
+			}
+			msgBytes, err := json.Marshal(fullMsg)
+			if err != nil {
+				logger.Errorf("Failed to marshal message: %v", err)
+				continue
+			}
+
+			to.TrySend(msgBytes)
+		}
+	}
+}
+
+// unregisterLocked removes client from the hub. Callers must hold h.mu. It
+// returns the presence announcements removePublisher deferred; the caller
+// must run them after releasing h.mu (see the comment on removePublisher for
+// why).
+func (h *Hub) unregisterLocked(client *Client) []func() {
+	if _, ok := h.clients[client.ID]; ok {
+		delete(h.clients, client.ID)
+		client.transport.Close()
+	}
+	return h.removePublisher(client.ID)
+}
+
+// Disconnect forcibly removes client from the hub and closes its connection
+// with reason, for a caller (in or outside this package) that has decided
+// the client can't be kept around, e.g. because it exceeded its outbound
+// drop threshold.
+func (h *Hub) Disconnect(client *Client, reason string) {
+	h.mu.Lock()
+	pending := h.unregisterLocked(client)
+	h.mu.Unlock()
+	for _, announce := range pending {
+		announce()
+	}
+
+	client.Conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason),
+		time.Now().Add(time.Second),
+	)
+	client.Conn.Close()
+}
+
+// roomFor returns the SFU room for roomID, creating it (and its presence
+// room on the shared hub) if it doesn't exist yet.
+func (h *Hub) roomFor(roomID string) *room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, exists := h.rooms[roomID]
+	if !exists {
+		r = newRoom(h.base.Room(roomID))
+		h.rooms[roomID] = r
+	}
+	return r
+}
+
+// Publish ingests a publisher's SDP offer, sets up track forwarding for the
+// room, and returns the SDP answer to send back to the publisher.
+func (h *Hub) Publish(clientID, roomID, sdp string) (string, error) {
+	r := h.roomFor(roomID)
+
+	h.mu.RLock()
+	client, ok := h.clients[clientID]
+	h.mu.RUnlock()
+	if ok {
+		r.presence.Join(&basehub.Member{ID: clientID, Transport: &signalTransport{client: client}})
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return "", fmt.Errorf("create publisher peer connection: %w", err)
+	}
+
+	pc.OnTrack(func(remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		h.forwardTrack(r, roomID, clientID, remote)
+	})
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}); err != nil {
+		return "", fmt.Errorf("set remote description: %w", err)
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", fmt.Errorf("create answer: %w", err)
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return "", fmt.Errorf("set local description: %w", err)
+	}
+
+	h.mu.Lock()
+	r.publishers[clientID] = pc
+	h.mu.Unlock()
+
+	logger.Infof("Publisher %s started publishing in room %s", clientID, roomID)
+	return answer.SDP, nil
+}
+
+// forwardTrack creates a local track mirroring a publisher's remote track,
+// attaches it to every existing subscriber, and pumps RTP packets from the
+// remote track into it until the publisher goes away.
+func (h *Hub) forwardTrack(r *room, roomID, publisherID string, remote *webrtc.TrackRemote) {
+	local, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, remote.ID(), roomID)
+	if err != nil {
+		logger.Errorf("create local track for forwarding: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	r.tracks[publisherID] = append(r.tracks[publisherID], local)
+	subs := make(map[string]*webrtc.PeerConnection, len(r.subscribers))
+	for id, sub := range r.subscribers {
+		if id != publisherID {
+			subs[id] = sub
+		}
+	}
+	h.mu.Unlock()
+
+	for id, sub := range subs {
+		sender, err := sub.AddTrack(local)
+		if err != nil {
+			logger.Errorf("add forwarded track to subscriber: %v", err)
+			continue
+		}
+		h.mu.Lock()
+		if r.senders[id] == nil {
+			r.senders[id] = make(map[string]*webrtc.RTPSender)
+		}
+		r.senders[id][local.ID()] = sender
+		h.mu.Unlock()
+	}
+
+	logger.Infof("Forwarding track %s from publisher %s in room %s", local.ID(), publisherID, roomID)
+	r.presence.Broadcast(&basehub.Envelope{
+		Kind:   basehub.KindSignal,
+		RoomID: roomID,
+		From:   publisherID,
+		Payload: trackEvent{
+			Type:        TrackAddedMsg,
+			PublisherID: publisherID,
+			TrackID:     local.ID(),
+		},
+	})
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := remote.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := local.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+// Subscribe wires a new PeerConnection for clientID containing every track
+// currently published by publisherID in roomID, returning the SDP offer the
+// subscriber must answer.
+func (h *Hub) Subscribe(clientID, publisherID, roomID string) (string, error) {
+	h.mu.Lock()
+	r, exists := h.rooms[roomID]
+	if !exists {
+		h.mu.Unlock()
+		return "", fmt.Errorf("room %s has no publishers", roomID)
+	}
+	tracks := append([]*webrtc.TrackLocalStaticRTP(nil), r.tracks[publisherID]...)
+	h.mu.Unlock()
+
+	if len(tracks) == 0 {
+		return "", fmt.Errorf("publisher %s has no tracks in room %s", publisherID, roomID)
+	}
+
+	h.mu.RLock()
+	client, ok := h.clients[clientID]
+	h.mu.RUnlock()
+	if ok {
+		r.presence.Join(&basehub.Member{ID: clientID, Transport: &signalTransport{client: client}})
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return "", fmt.Errorf("create subscriber peer connection: %w", err)
+	}
+
+	senders := make(map[string]*webrtc.RTPSender, len(tracks))
+	for _, t := range tracks {
+		sender, err := pc.AddTrack(t)
+		if err != nil {
+			return "", fmt.Errorf("add track %s to subscriber: %w", t.ID(), err)
+		}
+		senders[t.ID()] = sender
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return "", fmt.Errorf("create offer: %w", err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return "", fmt.Errorf("set local description: %w", err)
+	}
+
+	h.mu.Lock()
+	r.subscribers[clientID] = pc
+	r.senders[clientID] = senders
+	h.mu.Unlock()
+
+	logger.Infof("Subscriber %s subscribed to publisher %s in room %s", clientID, publisherID, roomID)
+	return offer.SDP, nil
+}
+
+// SubscribeAnswer completes the offer/answer exchange started by Subscribe
+// once the client sends back its SDP answer.
+func (h *Hub) SubscribeAnswer(clientID, roomID, sdp string) error {
+	h.mu.RLock()
+	r, exists := h.rooms[roomID]
+	h.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("room %s not found", roomID)
+	}
+
+	h.mu.RLock()
+	pc, ok := r.subscribers[clientID]
+	h.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no subscriber peer connection for %s", clientID)
+	}
+
+	return pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: sdp})
+}
+
+// Unpublish tears down a publisher's ingest peer connection, removes its
+// forwarded tracks' RTPSenders from every subscriber's peer connection, and
+// forgets the publisher's tracks so a republish starts clean.
+func (h *Hub) Unpublish(clientID, roomID string) {
+	h.mu.Lock()
+	r, tracks, ok := h.unpublishLocked(clientID, roomID)
+	h.mu.Unlock()
+	if ok {
+		h.announceUnpublish(r, clientID, roomID, tracks)
+	}
+}
+
+// unpublishLocked tears down a publisher's ingest peer connection and removes
+// its forwarded tracks' RTPSenders from every subscriber's peer connection.
+// Callers must hold h.mu. It returns the presence room, the tracks that were
+// removed, and whether roomID existed; announceUnpublish must be called with
+// that result after releasing h.mu, since delivering a trackRemoved broadcast
+// can call back into the hub via a lagging member's slow-consumer disconnect
+// callback, which would deadlock against h.mu if it were still held.
+func (h *Hub) unpublishLocked(clientID, roomID string) (*room, []*webrtc.TrackLocalStaticRTP, bool) {
+	r, exists := h.rooms[roomID]
+	if !exists {
+		return nil, nil, false
+	}
+	if pc, ok := r.publishers[clientID]; ok {
+		pc.Close()
+		delete(r.publishers, clientID)
+	}
+	tracks := r.tracks[clientID]
+	delete(r.tracks, clientID)
+
+	for subID, sub := range r.subscribers {
+		for _, t := range tracks {
+			sender, ok := r.senders[subID][t.ID()]
+			if !ok {
+				continue
+			}
+			if err := sub.RemoveTrack(sender); err != nil {
+				logger.Errorf("remove forwarded track %s from subscriber %s: %v", t.ID(), subID, err)
+			}
+			delete(r.senders[subID], t.ID())
+		}
+	}
+
+	return r, tracks, true
+}
+
+// announceUnpublish removes clientID from room presence and broadcasts
+// trackRemoved for each track it was forwarding. Must be called without h.mu
+// held (see unpublishLocked).
+func (h *Hub) announceUnpublish(r *room, clientID, roomID string, tracks []*webrtc.TrackLocalStaticRTP) {
+	r.presence.Leave(clientID)
+
+	for _, t := range tracks {
+		r.presence.Broadcast(&basehub.Envelope{
+			Kind:   basehub.KindSignal,
+			RoomID: roomID,
+			From:   clientID,
+			Payload: trackEvent{
+				Type:        TrackRemovedMsg,
+				PublisherID: clientID,
+				TrackID:     t.ID(),
+			},
+		})
+	}
+
+	logger.Infof("Publisher %s stopped publishing in room %s", clientID, roomID)
+}
+
+// removePublisher cleans up any room state left behind by a client that
+// disconnected without sending an explicit unpublish. Callers must hold
+// h.mu. It returns pending presence announcements the caller must run after
+// releasing h.mu (see unpublishLocked).
+func (h *Hub) removePublisher(clientID string) []func() {
+	var pending []func()
+	for roomID, r := range h.rooms {
+		roomID, r := roomID, r
+		if _, ok := r.publishers[clientID]; ok {
+			if ur, tracks, ok := h.unpublishLocked(clientID, roomID); ok {
+				pending = append(pending, func() { h.announceUnpublish(ur, clientID, roomID, tracks) })
+			}
+		}
+		if pc, ok := r.subscribers[clientID]; ok {
+			pc.Close()
+			delete(r.subscribers, clientID)
+			delete(r.senders, clientID)
+			pending = append(pending, func() { r.presence.Leave(clientID) })
 		}
 	}
+	return pending
 }
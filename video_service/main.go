@@ -1,11 +1,14 @@
 package main
 
 import (
+	"chatstreamapp/pkg/authtoken"
+	basehub "chatstreamapp/pkg/hub"
 	"chatstreamapp/video_service/internal/api"
 	"chatstreamapp/video_service/internal/hub"
 	"chatstreamapp/video_service/internal/logger"
 	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,10 +22,30 @@ func main() {
 
 	fmt.Println("🚀 Starting Video Service...")
 
-	// Initialize the signaling hub
-	sigHub := hub.NewHub()
+	helloSecret := os.Getenv("SIGNALING_HELLO_SECRET")
+	if helloSecret == "" {
+		fmt.Println("❌ SIGNALING_HELLO_SECRET must be set so clients can sign their hello handshake")
+		os.Exit(1)
+	}
+
+	// Initialize the signaling hub. If CLUSTER_BACKPLANE is configured,
+	// use a clustered hub so call presence is shared with other replicas
+	// of this service, and with chat-server if it's pointed at the same
+	// backplane and room IDs.
+	var sigHub *hub.Hub
+	bp, nodeID, clustered, err := basehub.BackplaneFromEnv()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if clustered {
+		sigHub = hub.NewClusteredHub(nodeID, bp)
+		fmt.Printf("✅ Clustered signaling hub initialized (node %s)\n", nodeID)
+	} else {
+		sigHub = hub.NewHub()
+		fmt.Println("✅ Signaling hub initialized")
+	}
 	go sigHub.Run()
-	fmt.Println("✅ Signaling hub initialized")
 
 	// Setup Gin router
 	router := gin.Default()
@@ -46,8 +69,11 @@ func main() {
 	router.Static("/static", "./web/static")
 	router.StaticFile("/", "./web/index.html")
 
-	// Initialize API routes
-	api.SetupRoutes(router, sigHub)
+	// Initialize API routes. nonces is per-process: if sigHub is clustered,
+	// a replayed hello landing on a different replica within the skew
+	// window isn't caught (see authtoken.NewNonceCache).
+	nonces := authtoken.NewNonceCache()
+	api.SetupRoutes(router, sigHub, []byte(helloSecret), nonces)
 
 	// Start server
 	fmt.Println("🌐 Video service starting on http://localhost:9090")